@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/build/autocertcache"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// CertConfig configures the server's Let's Encrypt certificate bootstrap.
+type CertConfig struct {
+	// CacheURL selects and configures the autocert.Cache implementation by
+	// URL scheme: gs://bucket[/prefix], s3://bucket[/prefix],
+	// file:///path/to/dir, or redis://host:port/db.
+	CacheURL string
+	// HostWhitelist restricts which hosts autocert will request
+	// certificates for. An empty list lets autocert request a certificate
+	// for any host that hits the server, which is an abuse vector.
+	HostWhitelist []string
+}
+
+// newCertManager builds an autocert.Manager from cfg, selecting a cache
+// implementation based on the scheme of cfg.CacheURL.
+func newCertManager(cfg CertConfig) (*autocert.Manager, error) {
+	cache, err := newCertCache(cfg.CacheURL)
+	if err != nil {
+		return nil, err
+	}
+	m := &autocert.Manager{
+		Cache:  cache,
+		Prompt: autocert.AcceptTOS,
+	}
+	if len(cfg.HostWhitelist) > 0 {
+		m.HostPolicy = autocert.HostWhitelist(cfg.HostWhitelist...)
+	}
+	return m, nil
+}
+
+func newCertCache(rawURL string) (autocert.Cache, error) {
+	if rawURL == "" {
+		return nil, errors.New("-https requires -cache to be set")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing -cache %q: %v", rawURL, err)
+	}
+	switch u.Scheme {
+	case "gs":
+		return newGCSCache(u)
+	case "s3":
+		return newS3Cache(u)
+	case "file":
+		return autocert.DirCache(u.Path), nil
+	case "redis":
+		return newRedisCache(u)
+	default:
+		return nil, fmt.Errorf("unsupported -cache scheme %q", u.Scheme)
+	}
+}
+
+func newGCSCache(u *url.URL) (autocert.Cache, error) {
+	cli, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	cache := autocertcache.NewGoogleCloudStorageCache(cli, u.Host)
+	if u.Path == "" || u.Path == "/" {
+		return cache, nil
+	}
+	return &prefixedCache{cache: cache, prefix: u.Path}, nil
+}
+
+// cacheKey joins a cache URL's path (used as a key prefix) with name.
+func cacheKey(prefix, name string) string {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// prefixedCache wraps an autocert.Cache that has no native notion of a key
+// prefix (such as the Google Cloud Storage cache) so it can honor the
+// optional path component of a -cache URL, the same way the s3 cache does.
+type prefixedCache struct {
+	cache  autocert.Cache
+	prefix string
+}
+
+func (c *prefixedCache) Get(ctx context.Context, name string) ([]byte, error) {
+	return c.cache.Get(ctx, cacheKey(c.prefix, name))
+}
+
+func (c *prefixedCache) Put(ctx context.Context, name string, data []byte) error {
+	return c.cache.Put(ctx, cacheKey(c.prefix, name), data)
+}
+
+func (c *prefixedCache) Delete(ctx context.Context, name string) error {
+	return c.cache.Delete(ctx, cacheKey(c.prefix, name))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// redisCache implements autocert.Cache's three-method interface against a
+// Redis server.
+type redisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisCache(u *url.URL) (*redisCache, error) {
+	db := 0
+	if p := strings.TrimPrefix(u.Path, "/"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, err
+		}
+		db = n
+	}
+	return &redisCache{
+		client: redis.NewClient(&redis.Options{Addr: u.Host, DB: db}),
+		prefix: "autocert/",
+	}, nil
+}
+
+func (c *redisCache) Get(ctx context.Context, name string) ([]byte, error) {
+	b, err := c.client.Get(ctx, c.prefix+name).Bytes()
+	if err == redis.Nil {
+		return nil, autocert.ErrCacheMiss
+	}
+	return b, err
+}
+
+func (c *redisCache) Put(ctx context.Context, name string, data []byte) error {
+	return c.client.Set(ctx, c.prefix+name, data, 0).Err()
+}
+
+func (c *redisCache) Delete(ctx context.Context, name string) error {
+	return c.client.Del(ctx, c.prefix+name).Err()
+}
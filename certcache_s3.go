@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// s3Cache implements autocert.Cache against an S3 bucket, mirroring
+// golang.org/x/build/autocertcache's Google Cloud Storage cache.
+type s3Cache struct {
+	bucket string
+	prefix string
+	client *s3.S3
+}
+
+func newS3Cache(u *url.URL) (*s3Cache, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return &s3Cache{
+		bucket: u.Host,
+		prefix: u.Path,
+		client: s3.New(sess),
+	}, nil
+}
+
+func (c *s3Cache) Get(ctx context.Context, name string) ([]byte, error) {
+	out, err := c.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(cacheKey(c.prefix, name)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, autocert.ErrCacheMiss
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+func (c *s3Cache) Put(ctx context.Context, name string, data []byte) error {
+	_, err := c.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(cacheKey(c.prefix, name)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (c *s3Cache) Delete(ctx context.Context, name string) error {
+	_, err := c.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(cacheKey(c.prefix, name)),
+	})
+	return err
+}
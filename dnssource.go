@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nf/vanity/internal/dns"
+)
+
+// dnsSource resolves go-import entries from go-import TXT records, as
+// described in "go help importpath".
+type dnsSource struct {
+	resolver string
+	dns      *dns.Client
+}
+
+func newDNSSource(resolver string) *dnsSource {
+	return &dnsSource{
+		resolver: resolver,
+		dns:      &dns.Client{Net: "tcp", SingleInflight: true},
+	}
+}
+
+func (s *dnsSource) Lookup(host string) ([]*Import, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(host+".", dns.TypeTXT)
+	r, _, err := s.dns.Exchange(m, s.resolver)
+	if err != nil {
+		return nil, err
+	}
+	var imports []*Import
+	for _, a := range r.Answer {
+		t, ok := a.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		for _, txt := range t.Txt {
+			if i := parseImport(txt); i != nil {
+				imports = append(imports, i)
+			}
+		}
+	}
+	if len(imports) == 0 {
+		return nil, fmt.Errorf("%w: no go-import TXT records for %q", ErrNoEntries, host)
+	}
+	return imports, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+// fileImport is the on-disk representation of a single go-import entry in a
+// fileSource config.
+type fileImport struct {
+	Prefix string `yaml:"prefix" toml:"prefix"`
+	VCS    string `yaml:"vcs" toml:"vcs"`
+	URL    string `yaml:"url" toml:"url"`
+}
+
+// fileSource resolves go-import entries from a static YAML or TOML file
+// mapping host to a list of import entries, similar to a traefik/gofer
+// static config file. It is intended for users who cannot set DNS TXT
+// records, such as on a shared domain or behind corporate DNS.
+//
+// The file is reloaded whenever it changes on disk, or when the process
+// receives SIGHUP.
+type fileSource struct {
+	path string
+
+	mu    sync.RWMutex
+	hosts map[string][]fileImport
+}
+
+// newFileSource loads path and starts watching it for changes.
+func newFileSource(path string) (*fileSource, error) {
+	s := &fileSource{path: path}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	go s.watchSignals()
+	go s.watchFile()
+	return s, nil
+}
+
+func (s *fileSource) Lookup(host string) ([]*Import, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fis, ok := s.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("%w %q in %s", ErrNoEntries, host, s.path)
+	}
+	imports := make([]*Import, len(fis))
+	for i, fi := range fis {
+		imports[i] = &Import{Prefix: fi.Prefix, VCS: fi.VCS, URL: fi.URL}
+	}
+	return imports, nil
+}
+
+func (s *fileSource) reload() error {
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	hosts := map[string][]fileImport{}
+	switch ext := strings.ToLower(filepath.Ext(s.path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &hosts); err != nil {
+			return fmt.Errorf("parsing %s: %v", s.path, err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(b), &hosts); err != nil {
+			return fmt.Errorf("parsing %s: %v", s.path, err)
+		}
+	default:
+		return fmt.Errorf("unrecognized config file extension %q", ext)
+	}
+	s.mu.Lock()
+	s.hosts = hosts
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *fileSource) watchSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		log.Printf("received SIGHUP, reloading %s", s.path)
+		if err := s.reload(); err != nil {
+			log.Printf("reloading %s: %v", s.path, err)
+		}
+	}
+}
+
+func (s *fileSource) watchFile() {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("watching %s: %v", s.path, err)
+		return
+	}
+	defer w.Close()
+	if err := w.Add(filepath.Dir(s.path)); err != nil {
+		log.Printf("watching %s: %v", s.path, err)
+		return
+	}
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != filepath.Clean(s.path) {
+				continue
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			log.Printf("%s changed, reloading", s.path)
+			if err := s.reload(); err != nil {
+				log.Printf("reloading %s: %v", s.path, err)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("watching %s: %v", s.path, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "errors"
+
+// ImportSource resolves the go-import entries for a vanity host. Server
+// consults one or more ImportSources in place of talking to DNS directly,
+// so that lookups can be backed by something other than TXT records.
+type ImportSource interface {
+	Lookup(host string) ([]*Import, error)
+}
+
+// ErrNoEntries is the sentinel error an ImportSource should wrap (with
+// fmt.Errorf's %w) when it simply has no go-import entries for the
+// requested host, as opposed to failing to reach or parse its backing
+// store. lookupErrorKind uses it to tell "host not configured" apart from
+// other lookup failures.
+var ErrNoEntries = errors.New("no entries for host")
+
+// fallbackSource consults primary, falling back to secondary when primary
+// returns an error (for example, because it has no entry for the host).
+type fallbackSource struct {
+	primary, secondary ImportSource
+}
+
+func (s *fallbackSource) Lookup(host string) ([]*Import, error) {
+	if imports, err := s.primary.Lookup(host); err == nil {
+		return imports, nil
+	}
+	return s.secondary.Lookup(host)
+}
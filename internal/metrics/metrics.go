@@ -0,0 +1,61 @@
+// Package metrics holds the Prometheus collectors used to instrument the
+// vanity server's request handling and import lookups.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics is a set of collectors for a single Server. Create one with New
+// and register it against a registry with Register; keeping the collectors
+// on a struct (rather than as package globals) lets tests use isolated
+// registries.
+type Metrics struct {
+	RequestsTotal  *prometheus.CounterVec
+	LookupDuration prometheus.Histogram
+	CacheEntries   prometheus.Gauge
+	CacheHits      prometheus.Counter
+	CacheMisses    prometheus.Counter
+	LookupErrors   *prometheus.CounterVec
+}
+
+// New returns a Metrics with all collectors initialized but not yet
+// registered against any registry.
+func New() *Metrics {
+	return &Metrics{
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vanity_requests_total",
+			Help: "Total number of requests served, by host and result. The host label is only the real request Host for requests that resolved to a known vanity host (result=\"meta\"); all others collapse to \"unknown\" so an attacker can't mint unbounded label series with arbitrary Host headers.",
+		}, []string{"host", "result"}),
+		LookupDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "vanity_lookup_duration_seconds",
+			Help: "Time spent resolving a host's go-import entries from the upstream ImportSource.",
+		}),
+		CacheEntries: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "vanity_cache_entries",
+			Help: "Number of hosts currently cached.",
+		}),
+		CacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "vanity_cache_hit_total",
+			Help: "Number of lookups served from the in-memory cache.",
+		}),
+		CacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "vanity_cache_miss_total",
+			Help: "Number of lookups that missed the in-memory cache.",
+		}),
+		LookupErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vanity_lookup_errors_total",
+			Help: "Number of failed upstream lookups, by error kind (notfound, timeout, or upstream).",
+		}, []string{"kind"}),
+	}
+}
+
+// Register adds every collector in m to reg.
+func (m *Metrics) Register(reg *prometheus.Registry) {
+	reg.MustRegister(
+		m.RequestsTotal,
+		m.LookupDuration,
+		m.CacheEntries,
+		m.CacheHits,
+		m.CacheMisses,
+		m.LookupErrors,
+	)
+}
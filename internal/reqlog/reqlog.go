@@ -0,0 +1,253 @@
+// Package reqlog provides an access-log middleware for the vanity server.
+// It writes one line per request to a file, when one is configured, that is
+// rotated by size and reopened on SIGHUP, and keeps a bounded ring buffer of recent
+// entries for display in a debug UI (in the same spirit as the existing
+// /anusz httpTracker).
+package reqlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Format selects the access log line format.
+type Format string
+
+const (
+	Common Format = "common"
+	JSON   Format = "json"
+)
+
+// DefaultRingSize is the number of recent entries kept for ServeHTTP's
+// debug view when the caller doesn't otherwise need to tune it.
+const DefaultRingSize = 200
+
+// DefaultMaxLogBytes is the log file size at which New rotates the file by
+// default, when the caller doesn't otherwise need to tune it.
+const DefaultMaxLogBytes = 100 << 20 // 100MiB
+
+// Entry is a single access log record.
+type Entry struct {
+	Time         time.Time     `json:"time"`
+	RemoteAddr   string        `json:"remote_addr"`
+	Method       string        `json:"method"`
+	Host         string        `json:"host"`
+	Path         string        `json:"path"`
+	Status       int           `json:"status"`
+	Bytes        uint64        `json:"bytes"`
+	Duration     time.Duration `json:"duration"`
+	UserAgent    string        `json:"user_agent"`
+	ImportHost   string        `json:"import_host,omitempty"`
+	ImportPrefix string        `json:"import_prefix,omitempty"`
+}
+
+// Result lets a handler wrapped by a Logger report which vanity host and
+// import prefix served the request, for inclusion in its access log entry.
+// Obtain the Result for the current request with ResultFromContext.
+type Result struct {
+	Host, Prefix string
+}
+
+type resultKey struct{}
+
+// ResultFromContext returns the *Result that Wrap attached to ctx, or nil
+// if ctx did not come from a request passed to a Logger's handler.
+func ResultFromContext(ctx context.Context) *Result {
+	res, _ := ctx.Value(resultKey{}).(*Result)
+	return res
+}
+
+// Logger is an access-log middleware. Create one with New.
+type Logger struct {
+	format   Format
+	path     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	ringMu sync.Mutex
+	ring   []Entry
+	ringN  int
+}
+
+// New creates a Logger that writes entries in the given format. If path is
+// non-empty, entries are appended to the named file; if it is empty, no log
+// lines are written and entries are only kept for ServeHTTP. The file is
+// rotated (renamed to path+".1", which is overwritten if it already exists)
+// once it would exceed maxBytes, and is also reopened on SIGHUP or a manual
+// call to Reopen, for compatibility with external tools like logrotate.
+// maxBytes <= 0 disables size-based rotation. ringN bounds how many recent
+// entries ServeHTTP renders.
+func New(format Format, path string, maxBytes int64, ringN int) (*Logger, error) {
+	l := &Logger{format: format, path: path, maxBytes: maxBytes, ringN: ringN}
+	if path != "" {
+		if err := l.openFile(); err != nil {
+			return nil, err
+		}
+		go l.watchSignals()
+	}
+	return l, nil
+}
+
+func (l *Logger) openFile() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	var size int64
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	l.mu.Lock()
+	old := l.file
+	l.file = f
+	l.size = size
+	l.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// rotateLocked closes the current log file, renames it aside, and opens a
+// fresh one at l.path. l.mu must be held by the caller.
+func (l *Logger) rotateLocked() error {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	l.size = 0
+	return nil
+}
+
+// Reopen closes and reopens the log file, for use after an external tool
+// (e.g. logrotate) has renamed it out from under the running process.
+func (l *Logger) Reopen() error {
+	if l.path == "" {
+		return nil
+	}
+	return l.openFile()
+}
+
+func (l *Logger) watchSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		if err := l.Reopen(); err != nil {
+			log.Printf("reqlog: reopening %s: %v", l.path, err)
+		}
+	}
+}
+
+// Wrap returns h wrapped with access logging. The resolved vanity host and
+// import prefix are taken from the Result attached to the request context;
+// a handler can populate it via ResultFromContext before returning.
+func (l *Logger) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		res := &Result{}
+		r = r.WithContext(context.WithValue(r.Context(), resultKey{}, res))
+
+		var bytesWritten uint64
+		var status int32
+		cw := &CountingResponseWriter{ResponseWriter: w, BytesWritten: &bytesWritten, Status: &status}
+		h.ServeHTTP(cw, r)
+
+		l.record(Entry{
+			Time:         start,
+			RemoteAddr:   r.RemoteAddr,
+			Method:       r.Method,
+			Host:         r.Host,
+			Path:         r.URL.Path,
+			Status:       int(atomic.LoadInt32(&status)),
+			Bytes:        atomic.LoadUint64(&bytesWritten),
+			Duration:     time.Since(start),
+			UserAgent:    r.UserAgent(),
+			ImportHost:   res.Host,
+			ImportPrefix: res.Prefix,
+		})
+	})
+}
+
+func (l *Logger) record(e Entry) {
+	l.write(e)
+	l.push(e)
+}
+
+func (l *Logger) write(e Entry) {
+	var line string
+	switch l.format {
+	case JSON:
+		b, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("reqlog: marshaling entry: %v", err)
+			return
+		}
+		line = string(b) + "\n"
+	default:
+		line = fmt.Sprintf("%s %s %s %s %s %d %d %s %q %s %q\n",
+			e.Time.Format(time.RFC3339), e.RemoteAddr, e.Method, e.Host, e.Path, e.Status, e.Bytes, e.Duration, e.UserAgent, e.ImportHost, e.ImportPrefix)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.maxBytes > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotateLocked(); err != nil {
+			log.Printf("reqlog: rotating %s: %v", l.path, err)
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("reqlog: writing entry: %v", err)
+	}
+}
+
+func (l *Logger) push(e Entry) {
+	l.ringMu.Lock()
+	defer l.ringMu.Unlock()
+	l.ring = append(l.ring, e)
+	if len(l.ring) > l.ringN {
+		l.ring = l.ring[len(l.ring)-l.ringN:]
+	}
+}
+
+// ServeHTTP renders the most recent entries in the same tabwriter style as
+// the existing /anusz debug UI. Mount it at e.g. /debug/reqlog.
+func (l *Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.ringMu.Lock()
+	entries := make([]Entry, len(l.ring))
+	copy(entries, l.ring)
+	l.ringMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 2, 1, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%v\t%s\t%s %s%s\t%d\t%d bytes\t%v\t%q\t%s\t%q\n",
+			e.Time.Format(time.RFC3339), e.RemoteAddr, e.Method, e.Host, e.Path, e.Status, e.Bytes, e.Duration, e.UserAgent, e.ImportHost, e.ImportPrefix)
+	}
+	tw.Flush()
+}
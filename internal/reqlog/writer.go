@@ -0,0 +1,36 @@
+package reqlog
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// CountingResponseWriter wraps an http.ResponseWriter, recording the number
+// of bytes written and the response status code into caller-supplied
+// counters. It backs both the httpTracker debug UI and this package's
+// access log middleware.
+type CountingResponseWriter struct {
+	http.ResponseWriter
+	BytesWritten *uint64 // Accessed atomically.
+	Status       *int32  // Accessed atomically; 0 until the first write.
+}
+
+func (w *CountingResponseWriter) WriteHeader(status int) {
+	atomic.StoreInt32(w.Status, int32(status))
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *CountingResponseWriter) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(w.Status) == 0 {
+		atomic.StoreInt32(w.Status, http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	atomic.AddUint64(w.BytesWritten, uint64(n))
+	return n, err
+}
+
+func (w *CountingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
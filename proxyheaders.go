@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseTrustedProxies parses a comma-separated list of CIDRs, as accepted
+// by the -trusted-proxies flag.
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var nets []*net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// proxyHeaders returns h wrapped with a middleware, modeled on gorilla/
+// handlers' ProxyHeaders, that rewrites r.RemoteAddr, r.Host and
+// r.URL.Scheme from the Forwarded, X-Forwarded-For, X-Real-IP,
+// X-Forwarded-Host and X-Forwarded-Proto headers. The headers are only
+// honored when the immediate peer's address falls within trusted; for any
+// other peer they are stripped, so a handler can never be tricked into
+// trusting them by a client that isn't a known reverse proxy.
+func proxyHeaders(trusted []*net.IPNet, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isTrustedProxy(trusted, r.RemoteAddr) {
+			applyForwardedHeaders(r)
+		} else {
+			stripForwardedHeaders(r)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func isTrustedProxy(trusted []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-Ip", "X-Forwarded-Host", "X-Forwarded-Proto"}
+
+func stripForwardedHeaders(r *http.Request) {
+	for _, h := range forwardedHeaders {
+		r.Header.Del(h)
+	}
+}
+
+// applyForwardedHeaders rewrites r in place from whichever forwarding
+// headers are present, preferring the RFC 7239 Forwarded header when set.
+func applyForwardedHeaders(r *http.Request) {
+	if f := r.Header.Get("Forwarded"); f != "" {
+		applyRFC7239(r, f)
+	} else {
+		if addr := firstField(r.Header.Get("X-Forwarded-For")); addr != "" {
+			r.RemoteAddr = addr
+		}
+		if addr := r.Header.Get("X-Real-Ip"); addr != "" {
+			r.RemoteAddr = addr
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			r.URL.Scheme = proto
+		}
+		if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+			r.Host = host
+		}
+	}
+}
+
+// applyRFC7239 applies the first hop of a Forwarded header, e.g.
+// `Forwarded: for=192.0.2.1;host=example.com;proto=https`.
+func applyRFC7239(r *http.Request, header string) {
+	first := strings.TrimSpace(strings.Split(header, ",")[0])
+	for _, part := range strings.Split(first, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.Trim(kv[1], `"`)
+		switch strings.ToLower(kv[0]) {
+		case "for":
+			r.RemoteAddr = v
+		case "host":
+			r.Host = v
+		case "proto":
+			r.URL.Scheme = v
+		}
+	}
+}
+
+func firstField(csv string) string {
+	f := strings.SplitN(csv, ",", 2)[0]
+	return strings.TrimSpace(f)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsTrustedProxy(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8,192.168.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{"10.1.2.3:1234", true},
+		{"192.168.1.5:1234", true},
+		{"8.8.8.8:1234", false},
+		{"not-an-addr", false},
+	}
+	for _, tt := range tests {
+		if got := isTrustedProxy(trusted, tt.remoteAddr); got != tt.want {
+			t.Errorf("isTrustedProxy(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := parseTrustedProxies("not-a-cidr"); err == nil {
+		t.Fatal("parseTrustedProxies: got nil error for invalid CIDR")
+	}
+}
+
+func TestProxyHeadersTrustedAndUntrusted(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := proxyHeaders(trusted, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5555"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got, want := w.Header().Get("X-Remote-Addr"), "203.0.113.7"; got != want {
+		t.Errorf("trusted proxy: RemoteAddr = %q, want %q", got, want)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "8.8.8.8:5555"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got, want := w.Header().Get("X-Remote-Addr"), "8.8.8.8:5555"; got != want {
+		t.Errorf("untrusted peer: RemoteAddr = %q, want %q (header should be stripped)", got, want)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"sync/atomic"
 	"text/tabwriter"
 	"time"
+
+	"github.com/nf/vanity/internal/reqlog"
 )
 
 func newHTTPTracker() *httpTracker {
@@ -35,7 +37,7 @@ func (t *httpTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	tw := tabwriter.NewWriter(w, 0, 2, 1, ' ', 0)
 	now := time.Now()
 	for _, req := range reqs {
-		fmt.Fprintf(tw, "%v\t%d bytes\t%v\t%q\n", now.Sub(req.start), atomic.LoadUint64(&req.bytesWritten), req.http.RemoteAddr, req.http.Header.Get("User-agent"))
+		fmt.Fprintf(tw, "%v\t%d\t%d bytes\t%v\t%q\n", now.Sub(req.start), atomic.LoadInt32(&req.status), atomic.LoadUint64(&req.bytesWritten), req.http.RemoteAddr, req.http.Header.Get("User-agent"))
 	}
 	tw.Flush()
 }
@@ -54,7 +56,7 @@ func (t *httpTracker) Wrap(h http.Handler) http.Handler {
 			delete(t.reqs, req)
 			t.mu.Unlock()
 		}()
-		w = &byteCountingResponseWriter{w, &req.bytesWritten}
+		w = &reqlog.CountingResponseWriter{ResponseWriter: w, BytesWritten: &req.bytesWritten, Status: &req.status}
 		h.ServeHTTP(w, r)
 	})
 }
@@ -63,21 +65,5 @@ type httpRequest struct {
 	http         *http.Request
 	start        time.Time
 	bytesWritten uint64 // Accessed atomically.
-}
-
-type byteCountingResponseWriter struct {
-	http.ResponseWriter
-	bytesWritten *uint64
-}
-
-func (w *byteCountingResponseWriter) Write(b []byte) (int, error) {
-	n, err := w.ResponseWriter.Write(b)
-	atomic.AddUint64(w.bytesWritten, uint64(n))
-	return n, err
-}
-
-func (w *byteCountingResponseWriter) Flush() {
-	if f, ok := w.ResponseWriter.(http.Flusher); ok {
-		f.Flush()
-	}
+	status       int32  // Accessed atomically.
 }
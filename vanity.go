@@ -15,12 +15,16 @@
 // (The author runs a public vanity instance at 108.59.82.123 that you may use
 // for your own redirects. It comes with no SLA, so use at your own risk.)
 //
+// If you cannot set DNS TXT records for your domain, pass -config with a
+// path to a YAML or TOML file mapping host to a list of
+// {prefix, vcs, url} entries instead; it is consulted before DNS and is
+// reloaded automatically when it changes or on SIGHUP.
+//
 // Written by Andrew Gerrand <adg@golang.org>
 //
 package main
 
 import (
-	"context"
 	"crypto/tls"
 	"errors"
 	"flag"
@@ -32,20 +36,28 @@ import (
 	"sync"
 	"time"
 
-	"cloud.google.com/go/compute/metadata"
-	"cloud.google.com/go/storage"
-	"golang.org/x/build/autocertcache"
-	"golang.org/x/crypto/acme/autocert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	"github.com/nf/vanity/internal/dns"
+	"github.com/nf/vanity/internal/metrics"
+	"github.com/nf/vanity/internal/reqlog"
 )
 
 var (
-	httpAddr      = flag.String("http", "", "HTTP listen address")
-	httpsAddr     = flag.String("https", "", "HTTPs listen address (enables letsencrypt)")
-	resolverAddr  = flag.String("resolver", "8.8.8.8:53", "DNS resolver address")
-	refreshPeriod = flag.Duration("refresh", 15*time.Minute, "refresh period")
-	anusEnabled   = flag.Bool("anus", false, "enable anus.io web root")
+	httpAddr       = flag.String("http", "", "HTTP listen address")
+	httpsAddr      = flag.String("https", "", "HTTPs listen address (enables letsencrypt)")
+	resolverAddr   = flag.String("resolver", "8.8.8.8:53", "DNS resolver address")
+	refreshPeriod  = flag.Duration("refresh", 15*time.Minute, "refresh period")
+	configFile     = flag.String("config", "", "static import config file (YAML or TOML); consulted before DNS, hot-reloaded on change or SIGHUP")
+	metricsAddr    = flag.String("metrics-addr", "", "if set, serve Prometheus metrics at /metrics and the request log debug view at /debug/reqlog on this private address")
+	reqlogFormat   = flag.String("reqlog-format", "common", "access log format: common or json")
+	reqlogFile     = flag.String("reqlog-file", "", "if set, append access log entries to this file (reopened on SIGHUP)")
+	trustedProxies = flag.String("trusted-proxies", "", "comma-separated CIDR list of reverse proxies trusted to set X-Forwarded-*/Forwarded headers")
+	certCache      = flag.String("cache", "", "autocert cache backend URL: gs://bucket[/prefix], s3://bucket[/prefix], file:///path, or redis://host:port/db")
+	hostWhitelist  = flag.String("hostwhitelist", "", "comma-separated list of hosts autocert may request certificates for")
+	redirectHTTP   = flag.Bool("redirect-http", false, "when -https is set, make the HTTP listener serve only ACME HTTP-01 challenges and 301-redirect everything else to https")
+	hstsEnabled    = flag.Bool("hsts", false, "send a Strict-Transport-Security header on HTTPS responses")
+	anusEnabled    = flag.Bool("anus", false, "enable anus.io web root")
 )
 
 func main() {
@@ -58,7 +70,36 @@ func main() {
 		anusHandler = t.Wrap(http.HandlerFunc(anus))
 	}
 
-	s := NewServer(*resolverAddr, *refreshPeriod)
+	var source ImportSource = newDNSSource(*resolverAddr)
+	if *configFile != "" {
+		fs, err := newFileSource(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		source = &fallbackSource{primary: fs, secondary: source}
+	}
+	s := NewServer(source, *refreshPeriod, *hstsEnabled)
+
+	rl, err := reqlog.New(reqlog.Format(*reqlogFormat), *reqlogFile, reqlog.DefaultMaxLogBytes, reqlog.DefaultRingSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		s.RegisterMetrics(reg)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		// /debug/reqlog is mounted here rather than on the public mux: it
+		// reveals client IPs, user agents and resolved vanity hosts for
+		// every request, which is more sensitive than /metrics itself.
+		mux.Handle("/debug/reqlog", rl)
+		go func() {
+			log.Println("Starting metrics server on", *metricsAddr)
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+
 	var rootHandler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		if *anusEnabled && r.URL.Path == "/" && r.FormValue("go-get") != "1" {
@@ -67,24 +108,35 @@ func main() {
 		}
 		s.ServeHTTP(w, r)
 	})
+	rootHandler = rl.Wrap(rootHandler)
+
+	trusted, err := parseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rootHandler = proxyHeaders(trusted, rootHandler)
+	http.Handle("/", rootHandler)
+
+	// httpHandler serves the plain HTTP listener. It defaults to the same
+	// handler as HTTPS, but is narrowed to just the ACME HTTP-01 challenge
+	// plus an HTTPS redirect when -redirect-http is set, since go get over
+	// plaintext is a supply-chain hazard.
+	httpHandler := http.Handler(http.DefaultServeMux)
 
 	if *httpsAddr != "" {
-		if !metadata.OnGCE() {
-			log.Fatal("Not on GCE. HTTPS only supported on GCE using letsencrypt. Exiting.")
+		var whitelist []string
+		if *hostWhitelist != "" {
+			whitelist = strings.Split(*hostWhitelist, ",")
 		}
-		cli, err := storage.NewClient(context.Background())
+		m, err := newCertManager(CertConfig{CacheURL: *certCache, HostWhitelist: whitelist})
 		if err != nil {
 			log.Fatal(err)
 		}
-		bucket, err := metadata.InstanceAttributeValue("vanity-letsencrypt-bucket")
-		if err != nil {
-			log.Fatal(err)
+		fallback := http.Handler(http.DefaultServeMux)
+		if *redirectHTTP {
+			fallback = http.HandlerFunc(redirectToHTTPS)
 		}
-		m := &autocert.Manager{
-			Cache:  autocertcache.NewGoogleCloudStorageCache(cli, bucket), // TODO
-			Prompt: autocert.AcceptTOS,
-		}
-		rootHandler = m.HTTPHandler(rootHandler)
+		httpHandler = m.HTTPHandler(fallback)
 		srv := &http.Server{
 			Addr:      *httpsAddr,
 			TLSConfig: &tls.Config{GetCertificate: m.GetCertificate},
@@ -98,32 +150,40 @@ func main() {
 	if *httpAddr != "" {
 		go func() {
 			log.Println("Starting HTTP server on", *httpAddr)
-			log.Fatal(http.ListenAndServe(*httpAddr, nil))
+			log.Fatal(http.ListenAndServe(*httpAddr, httpHandler))
 		}()
 	}
 
-	http.Handle("/", rootHandler)
 	select {}
 }
 
 type Server struct {
-	resolver string
-	refresh  time.Duration
-	dns      *dns.Client
+	source  ImportSource
+	refresh time.Duration
+	hsts    bool
+	metrics *metrics.Metrics
 
 	mu    sync.RWMutex
 	hosts map[string]*Host
 }
 
-func NewServer(resolver string, refresh time.Duration) *Server {
+func NewServer(source ImportSource, refresh time.Duration, hsts bool) *Server {
 	return &Server{
-		resolver: resolver,
-		refresh:  refresh,
-		dns:      &dns.Client{Net: "tcp", SingleInflight: true},
-		hosts:    map[string]*Host{},
+		source:  source,
+		refresh: refresh,
+		hsts:    hsts,
+		metrics: metrics.New(),
+		hosts:   map[string]*Host{},
 	}
 }
 
+// RegisterMetrics registers s's Prometheus collectors against reg. Tests can
+// pass an isolated *prometheus.Registry to avoid colliding with other
+// Servers registered against the default registry.
+func (s *Server) RegisterMetrics(reg *prometheus.Registry) {
+	s.metrics.Register(reg)
+}
+
 type Host struct {
 	imports []*Import
 	expiry  time.Time
@@ -140,8 +200,20 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		host = r.Host
 	}
+	if res := reqlog.ResultFromContext(r.Context()); res != nil {
+		res.Host = host
+	}
+	isHTTPS := r.TLS != nil || r.URL.Scheme == "https"
+	if s.hsts && isHTTPS {
+		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+	}
 	if r.FormValue("go-get") != "1" {
-		http.Redirect(w, r, "http://godoc.org/"+host+r.URL.Path, http.StatusFound)
+		s.metrics.RequestsTotal.WithLabelValues(unresolvedMetricsHost, "redirect").Inc()
+		scheme := "http"
+		if isHTTPS {
+			scheme = "https"
+		}
+		http.Redirect(w, r, scheme+"://godoc.org/"+host+r.URL.Path, http.StatusFound)
 		return
 	}
 	h := s.match(host)
@@ -150,10 +222,15 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h, err = s.lookup(host)
 		if err != nil {
 			log.Printf("lookup %q: %v", host, err)
+			s.metrics.RequestsTotal.WithLabelValues(unresolvedMetricsHost, "notfound").Inc()
 			http.NotFound(w, r)
 			return
 		}
 	}
+	if res := reqlog.ResultFromContext(r.Context()); res != nil && len(h.imports) > 0 {
+		res.Prefix = h.imports[0].Prefix
+	}
+	s.metrics.RequestsTotal.WithLabelValues(host, "meta").Inc()
 	if err := metaTmpl.Execute(w, h.imports); err != nil {
 		log.Println("writing response:", err)
 	}
@@ -167,39 +244,49 @@ func (s *Server) match(host string) *Host {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if h := s.hosts[host]; h != nil && h.expiry.After(time.Now()) {
+		s.metrics.CacheHits.Inc()
 		return h
 	}
+	s.metrics.CacheMisses.Inc()
 	return nil
 }
 
 func (s *Server) lookup(name string) (*Host, error) {
-	m := &dns.Msg{}
-	m.SetQuestion(name+".", dns.TypeTXT)
-	r, _, err := s.dns.Exchange(m, s.resolver)
+	start := time.Now()
+	imports, err := s.source.Lookup(name)
+	s.metrics.LookupDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
+		s.metrics.LookupErrors.WithLabelValues(lookupErrorKind(err)).Inc()
 		return nil, err
 	}
-	h := &Host{expiry: time.Now().Add(s.refresh)}
-	for _, a := range r.Answer {
-		t, ok := a.(*dns.TXT)
-		if !ok {
-			continue
-		}
-		for _, s := range t.Txt {
-			if i := parseImport(s); i != nil {
-				h.imports = append(h.imports, i)
-			}
-		}
-	}
-	if len(h.imports) == 0 {
-		return nil, errors.New("no go-import TXT records found")
-	}
+	h := &Host{imports: imports, expiry: time.Now().Add(s.refresh)}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.hosts[name] = h
+	s.metrics.CacheEntries.Set(float64(len(s.hosts)))
 	return h, nil
 }
 
+// unresolvedMetricsHost is the vanity_requests_total host label used for
+// any request whose Host did not resolve to a known vanity host. r.Host is
+// entirely client-controlled, so using it verbatim in every result would
+// let an attacker mint unbounded Prometheus label series.
+const unresolvedMetricsHost = "unknown"
+
+// lookupErrorKind classifies err for the vanity_lookup_errors_total metric.
+// It inspects typed errors rather than matching on message text, so an
+// ImportSource's wording can't silently break the metric's labeling.
+func lookupErrorKind(err error) string {
+	if errors.Is(err, ErrNoEntries) {
+		return "notfound"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "upstream"
+}
+
 func parseImport(s string) *Import {
 	const p = "go-import "
 	if !strings.HasPrefix(s, p) {
@@ -212,6 +299,14 @@ func parseImport(s string) *Import {
 	return &Import{f[0], f[1], f[2]}
 }
 
+// redirectToHTTPS 301-redirects every request to its https:// equivalent,
+// preserving host and path. It is used as the HTTP listener's fallback
+// handler (after the ACME HTTP-01 challenge path) when -redirect-http is
+// set.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
 func anus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type stubSource struct {
+	imports []*Import
+	err     error
+}
+
+func (s *stubSource) Lookup(host string) ([]*Import, error) {
+	return s.imports, s.err
+}
+
+func TestServeHTTPRequestsTotalLabeling(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     ImportSource
+		goGet      bool
+		wantHost   string
+		wantResult string
+	}{
+		{
+			name:       "redirect without go-get",
+			source:     &stubSource{},
+			wantHost:   unresolvedMetricsHost,
+			wantResult: "redirect",
+		},
+		{
+			name:       "resolved vanity host",
+			source:     &stubSource{imports: []*Import{{Prefix: "example.org/foo", VCS: "git", URL: "https://github.com/example/foo"}}},
+			goGet:      true,
+			wantHost:   "example.org",
+			wantResult: "meta",
+		},
+		{
+			name:       "unresolved host",
+			source:     &stubSource{err: ErrNoEntries},
+			goGet:      true,
+			wantHost:   unresolvedMetricsHost,
+			wantResult: "notfound",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(tt.source, time.Minute, false)
+			reg := prometheus.NewRegistry()
+			s.RegisterMetrics(reg)
+
+			target := "/"
+			if tt.goGet {
+				target = "/?go-get=1"
+			}
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			r.Host = "example.org"
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			if got := testutil.ToFloat64(s.metrics.RequestsTotal.WithLabelValues(tt.wantHost, tt.wantResult)); got != 1 {
+				t.Errorf("RequestsTotal{host=%q,result=%q} = %v, want 1", tt.wantHost, tt.wantResult, got)
+			}
+		})
+	}
+}